@@ -0,0 +1,104 @@
+package aws
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// configLease describes the TTL/MaxTTL that newly issued secrets should use,
+// falling back to the mount's system defaults when the operator hasn't set
+// anything under config/lease.
+type configLease struct {
+	Lease    time.Duration `json:"lease"`
+	LeaseMax time.Duration `json:"lease_max"`
+}
+
+func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend, error) {
+	b := Backend(conf)
+	if err := b.Setup(ctx, conf); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+type backend struct {
+	*framework.Backend
+
+	clientMutex sync.RWMutex
+	iamClient   iamiface.IAMAPI
+	ecrClient   ecriface.ECRAPI
+
+	// ecrClientForKeysOverride lets tests substitute a fake ECR client for
+	// ecrClientForKeys, which otherwise always builds a real one scoped to
+	// whatever access key/secret key it's given. Left nil in production.
+	ecrClientForKeysOverride ecriface.ECRAPI
+}
+
+func Backend(conf *logical.BackendConfig) *backend {
+	var b backend
+
+	b.Backend = &framework.Backend{
+		Help: "",
+		Paths: []*framework.Path{
+			pathConfigRoot(&b),
+			pathConfigLease(&b),
+			pathRole(&b),
+			pathRoles(&b),
+			pathCreds(&b),
+		},
+		Secrets: []*framework.Secret{
+			secretAccessKeys(&b),
+			secretSTSCreds(&b),
+			secretECRToken(&b),
+		},
+		BackendType:       logical.TypeLogical,
+		WALRollback:       b.walRollback,
+		WALRollbackMinAge: 5 * time.Minute,
+	}
+
+	return &b
+}
+
+// Lease returns the TTL/MaxTTL to apply to a freshly issued secret, reading
+// the operator-configured config/lease entry and falling back to the
+// system mount defaults when it hasn't been set.
+func (b *backend) Lease(ctx context.Context, s logical.Storage, requestedTTL int64) (*configLease, error) {
+	entry, err := s.Get(ctx, "config/lease")
+	if err != nil {
+		return nil, err
+	}
+
+	lease := &configLease{
+		Lease:    b.System().DefaultLeaseTTL(),
+		LeaseMax: b.System().MaxLeaseTTL(),
+	}
+	if entry != nil {
+		if err := entry.DecodeJSON(lease); err != nil {
+			return nil, err
+		}
+	}
+
+	if requestedTTL > 0 {
+		requested := time.Duration(requestedTTL) * time.Second
+		if requested < lease.Lease || lease.Lease == 0 {
+			lease.Lease = requested
+		}
+	}
+
+	return lease, nil
+}
+
+func (b *backend) walRollback(ctx context.Context, req *logical.Request, kind string, data interface{}) error {
+	switch kind {
+	case "user":
+		return b.pathUserRollback(ctx, req, kind, data)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,245 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// awsConfig builds the base *aws.Config shared by the IAM, ECR, and STS
+// clients from the stored root configuration. Credentials resolve in order:
+// static access_key/secret_key, then Vault's plugin identity token exchanged
+// via identity_token_audience/role_arn, then whatever the AWS SDK's own
+// default credential chain finds (EC2 instance profile, ECS task role, or
+// AWS_WEB_IDENTITY_TOKEN_FILE/AWS_ROLE_ARN) when awsConfig.Credentials is
+// left nil.
+func (b *backend) awsConfig(ctx context.Context, config rootConfig) (*aws.Config, error) {
+	awsConfig := &aws.Config{}
+	if config.Region != "" {
+		awsConfig.Region = aws.String(config.Region)
+	}
+
+	switch {
+	case config.AccessKey != "" || config.SecretKey != "":
+		awsConfig.Credentials = credentials.NewStaticCredentials(config.AccessKey, config.SecretKey, "")
+	default:
+		webIdentityCreds, err := b.webIdentityCredentials(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		if webIdentityCreds != nil {
+			awsConfig.Credentials = webIdentityCreds
+		}
+		// Else leave Credentials nil: session.NewSession will fall back to
+		// the SDK's default provider chain.
+	}
+
+	maxRetries, minBackoff, maxBackoff := config.retryConfig()
+	awsConfig.MaxRetries = aws.Int(maxRetries)
+	awsConfig.Retryer = client.DefaultRetryer{
+		NumMaxRetries: maxRetries,
+		MinRetryDelay: minBackoff,
+		MaxRetryDelay: maxBackoff,
+	}
+
+	return awsConfig, nil
+}
+
+func (b *backend) clientIAM(ctx context.Context, s logical.Storage) (iamiface.IAMAPI, error) {
+	b.clientMutex.RLock()
+	if b.iamClient != nil {
+		defer b.clientMutex.RUnlock()
+		return b.iamClient, nil
+	}
+	b.clientMutex.RUnlock()
+
+	b.clientMutex.Lock()
+	defer b.clientMutex.Unlock()
+
+	if b.iamClient != nil {
+		return b.iamClient, nil
+	}
+
+	config, err := readConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	awsCfg, err := b.awsConfig(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	if config.IAMEndpoint != "" {
+		awsCfg.Endpoint = aws.String(config.IAMEndpoint)
+	}
+
+	sess, err := session.NewSession(awsCfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating IAM session: %w", err)
+	}
+
+	b.iamClient = iam.New(sess)
+	return b.iamClient, nil
+}
+
+func (b *backend) clientECR(ctx context.Context, s logical.Storage, auth *logical.Response) (ecriface.ECRAPI, error) {
+	b.clientMutex.RLock()
+	if b.ecrClient != nil {
+		defer b.clientMutex.RUnlock()
+		return b.ecrClient, nil
+	}
+	b.clientMutex.RUnlock()
+
+	b.clientMutex.Lock()
+	defer b.clientMutex.Unlock()
+
+	if b.ecrClient != nil {
+		return b.ecrClient, nil
+	}
+
+	config, err := readConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	awsCfg, err := b.awsConfig(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := session.NewSession(awsCfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating ECR session: %w", err)
+	}
+
+	b.ecrClient = ecr.New(sess)
+	return b.ecrClient, nil
+}
+
+// clientSTS builds an STS client from the root credentials. Unlike the IAM
+// and ECR clients it isn't cached on the backend: STS clients are cheap and
+// callers sometimes need one wrapping a different config (e.g. cross-account
+// assume-role chaining).
+func (b *backend) clientSTS(ctx context.Context, s logical.Storage) (stsiface.STSAPI, error) {
+	config, err := readConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	awsCfg, err := b.awsConfig(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	if config.STSEndpoint != "" {
+		awsCfg.Endpoint = aws.String(config.STSEndpoint)
+	}
+
+	sess, err := session.NewSession(awsCfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating STS session: %w", err)
+	}
+
+	return sts.New(sess), nil
+}
+
+// ecrClientForKeys builds an uncached ECR client authenticated as a specific
+// IAM access key/secret key pair, rather than the shared root-credentialed
+// client. It's used right after creating an IAM user's access key, so the
+// very first GetAuthorizationToken call is made as that user.
+func (b *backend) ecrClientForKeys(ctx context.Context, s logical.Storage, accessKey, secretKey string) (ecriface.ECRAPI, error) {
+	if b.ecrClientForKeysOverride != nil {
+		return b.ecrClientForKeysOverride, nil
+	}
+
+	config, err := readConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	awsCfg, err := b.awsConfig(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	awsCfg.Credentials = credentials.NewStaticCredentials(accessKey, secretKey, "")
+
+	sess, err := session.NewSession(awsCfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating ECR session: %w", err)
+	}
+
+	return ecr.New(sess), nil
+}
+
+// clientECRForRole returns an ECR client to use for the role's
+// GetAuthorizationToken call. If the role has no assume_role_arn, this is
+// just the shared, cached root-credentialed client with a nil expiration.
+// Otherwise it assumes assume_role_arn with the root credentials and builds
+// a fresh, uncached client from the resulting temporary credentials, whose
+// expiration is returned so the caller can use it as the token's TTL.
+func (b *backend) clientECRForRole(ctx context.Context, s logical.Storage, displayName string, role *awsRoleEntry) (ecriface.ECRAPI, *time.Time, error) {
+	if role == nil || role.AssumeRoleARN == "" {
+		ecrClient, err := b.clientECR(ctx, s, nil)
+		return ecrClient, nil, err
+	}
+
+	stsClient, err := b.clientSTS(ctx, s)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	usernameTemplate := role.SessionNameTemplate
+	if usernameTemplate == "" {
+		usernameTemplate = fmt.Sprintf("vault-ecr-%s", role.Name)
+	}
+	sessionName, err := genUsername(displayName, role.Name, usernameTemplate)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	assumeInput := &sts.AssumeRoleInput{
+		RoleArn:         aws.String(role.AssumeRoleARN),
+		RoleSessionName: aws.String(sessionName),
+	}
+	if role.ExternalID != "" {
+		assumeInput.ExternalId = aws.String(role.ExternalID)
+	}
+
+	out, err := stsClient.AssumeRole(assumeInput)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error assuming %s for cross-account ECR access: %w", role.AssumeRoleARN, err)
+	}
+
+	config, err := readConfig(ctx, s)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	awsCfg, err := b.awsConfig(ctx, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	awsCfg.Credentials = credentials.NewStaticCredentials(
+		*out.Credentials.AccessKeyId,
+		*out.Credentials.SecretAccessKey,
+		*out.Credentials.SessionToken,
+	)
+
+	sess, err := session.NewSession(awsCfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating cross-account ECR session: %w", err)
+	}
+
+	return ecr.New(sess), out.Credentials.Expiration, nil
+}
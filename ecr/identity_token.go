@@ -0,0 +1,76 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/hashicorp/vault/sdk/helper/pluginutil"
+)
+
+// defaultIdentityTokenTTL is used when the operator sets
+// identity_token_audience without an explicit identity_token_ttl.
+const defaultIdentityTokenTTL = 2 * time.Minute
+
+// pluginIdentityTokenFetcher implements stscreds.TokenFetcher by asking
+// Vault to mint a fresh plugin identity token (a JWT Vault signs with its
+// own key) scoped to the configured audience, each time STS needs one.
+type pluginIdentityTokenFetcher struct {
+	b        *backend
+	audience string
+	ttl      time.Duration
+}
+
+func (f pluginIdentityTokenFetcher) FetchToken(ctx credentials.Context) ([]byte, error) {
+	resp, err := f.b.System().GenerateIdentityToken(ctx, &pluginutil.IdentityTokenRequest{
+		Audience: f.audience,
+		TTL:      f.ttl,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error generating plugin identity token: %w", err)
+	}
+	return []byte(resp.Token.Token()), nil
+}
+
+// webIdentityCredentials exchanges either Vault's own plugin identity token
+// (when identity_token_audience/role_arn are set) or, failing that, lets the
+// caller fall through to the AWS SDK's own AWS_WEB_IDENTITY_TOKEN_FILE
+// handling for STS credentials via AssumeRoleWithWebIdentity.
+func (b *backend) webIdentityCredentials(ctx context.Context, config rootConfig) (*credentials.Credentials, error) {
+	if config.IdentityTokenAudience == "" || config.RoleARN == "" {
+		return nil, nil
+	}
+
+	ttl := config.IdentityTokenTTL
+	if ttl <= 0 {
+		ttl = defaultIdentityTokenTTL
+	}
+
+	// This exchange itself requires no AWS credentials, only the signed
+	// plugin identity token, so use an unauthenticated STS session.
+	stsCfg := &aws.Config{}
+	if config.Region != "" {
+		stsCfg.Region = aws.String(config.Region)
+	}
+	if config.STSEndpoint != "" {
+		stsCfg.Endpoint = aws.String(config.STSEndpoint)
+	}
+	sess, err := session.NewSession(stsCfg)
+	if err != nil {
+		return nil, fmt.Errorf("error creating STS session for identity token exchange: %w", err)
+	}
+
+	provider := stscreds.NewWebIdentityRoleProviderWithOptions(
+		sts.New(sess),
+		config.RoleARN,
+		"vault-ecr-secrets",
+		pluginIdentityTokenFetcher{b: b, audience: config.IdentityTokenAudience, ttl: ttl},
+	)
+
+	return credentials.NewCredentials(provider), nil
+}
@@ -0,0 +1,256 @@
+package aws
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/parseutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const defaultUserNameTemplate = `{{ printf "vault-%s-%s-%s" (.DisplayName) (.PolicyName) (unix_time) | truncate 64 }}`
+
+// defaultFederationNameTemplate is used for GetFederationToken's Name
+// parameter, which AWS caps at 32 chars (unlike the 64-char RoleSessionName
+// AssumeRole accepts), so it needs its own, shorter truncation.
+const defaultFederationNameTemplate = `{{ printf "vault-%s-%s" (.PolicyName) (unix_time) | truncate 32 }}`
+
+// Defaults for the retry/backoff knobs below, used by retryConfig for any
+// knob the operator leaves unset.
+const (
+	defaultMaxRetries      = 30
+	defaultMinRetryBackoff = 100 * time.Millisecond
+	defaultMaxRetryBackoff = 5 * time.Second
+)
+
+// rootConfig holds the AWS credentials and tuning knobs the backend uses to
+// talk to IAM and ECR. It is stored, unencrypted, under storageKey.
+type rootConfig struct {
+	AccessKey        string            `json:"access_key"`
+	SecretKey        string            `json:"secret_key"`
+	Region           string            `json:"region"`
+	IAMEndpoint      string            `json:"iam_endpoint"`
+	STSEndpoint      string            `json:"sts_endpoint"`
+	UsernameTemplate string            `json:"username_template"`
+	DefaultIAMTags   map[string]string `json:"default_iam_tags"`
+	MaxRetries       int               `json:"max_retries"`
+	MinRetryBackoff  time.Duration     `json:"min_retry_backoff"`
+	MaxRetryBackoff  time.Duration     `json:"max_retry_backoff"`
+
+	// IdentityTokenAudience/IdentityTokenTTL/RoleARN let the backend bootstrap
+	// credentials for EKS/IRSA-style deployments by exchanging Vault's own
+	// plugin identity token for STS credentials via AssumeRoleWithWebIdentity,
+	// instead of requiring long-lived access_key/secret_key. When unset, and
+	// access_key/secret_key are also unset, the backend falls back to
+	// whatever the AWS SDK's default credential chain finds (EC2 instance
+	// profile, ECS task role, or AWS_WEB_IDENTITY_TOKEN_FILE/AWS_ROLE_ARN).
+	IdentityTokenAudience string        `json:"identity_token_audience"`
+	IdentityTokenTTL      time.Duration `json:"identity_token_ttl"`
+	RoleARN               string        `json:"role_arn"`
+}
+
+// retryConfig returns the configured max-retries/backoff bounds, falling
+// back to the hard-coded defaults for whichever ones the operator hasn't
+// set.
+func (c rootConfig) retryConfig() (maxRetries int, minBackoff, maxBackoff time.Duration) {
+	maxRetries = c.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultMaxRetries
+	}
+	minBackoff = c.MinRetryBackoff
+	if minBackoff <= 0 {
+		minBackoff = defaultMinRetryBackoff
+	}
+	maxBackoff = c.MaxRetryBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxRetryBackoff
+	}
+	return
+}
+
+func pathConfigRoot(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/root",
+		Fields: map[string]*framework.FieldSchema{
+			"access_key": {
+				Type:        framework.TypeString,
+				Description: "AWS Access Key ID used to issue IAM users and ECR tokens.",
+			},
+			"secret_key": {
+				Type:        framework.TypeString,
+				Description: "AWS Secret Access Key paired with access_key.",
+			},
+			"region": {
+				Type:        framework.TypeString,
+				Description: "AWS region for the IAM and ECR clients.",
+			},
+			"iam_endpoint": {
+				Type:        framework.TypeString,
+				Description: "Custom IAM endpoint URL, for use with ISO/GovCloud partitions.",
+			},
+			"sts_endpoint": {
+				Type:        framework.TypeString,
+				Description: "Custom STS endpoint URL, for use with ISO/GovCloud partitions.",
+			},
+			"username_template": {
+				Type:        framework.TypeString,
+				Description: "Template describing how dynamic usernames are generated.",
+			},
+			"default_iam_tags": {
+				Type:        framework.TypeKVPairs,
+				Description: "Tags applied to every IAM user this backend creates, merged with any role-level iam_tags.",
+			},
+			"max_retries": {
+				Type:        framework.TypeInt,
+				Default:     defaultMaxRetries,
+				Description: "Maximum number of retries for AWS API calls, both at the SDK transport level and for the application-level ECR token propagation wait.",
+			},
+			"min_retry_backoff": {
+				Type:        framework.TypeString,
+				Default:     defaultMinRetryBackoff.String(),
+				Description: "Base delay for the ECR token propagation retry's full-jitter exponential backoff, e.g. \"100ms\".",
+			},
+			"max_retry_backoff": {
+				Type:        framework.TypeString,
+				Default:     defaultMaxRetryBackoff.String(),
+				Description: "Cap on the ECR token propagation retry's backoff delay, e.g. \"5s\".",
+			},
+			"identity_token_audience": {
+				Type:        framework.TypeString,
+				Description: "Audience claim for the plugin identity token Vault generates, which is exchanged with STS for credentials. Requires role_arn.",
+			},
+			"identity_token_ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: "TTL for the plugin identity token generated for the identity_token_audience exchange.",
+			},
+			"role_arn": {
+				Type:        framework.TypeString,
+				Description: "Role to assume, via AssumeRoleWithWebIdentity, with the plugin identity token (identity_token_audience). Ignored when identity_token_audience is unset; the AWS_WEB_IDENTITY_TOKEN_FILE environment credential chain takes its role from AWS_ROLE_ARN instead.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{Callback: b.pathConfigRootWrite},
+			logical.ReadOperation:   &framework.PathOperation{Callback: b.pathConfigRootRead},
+		},
+	}
+}
+
+func (b *backend) pathConfigRootWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	minBackoff, err := parseutil.ParseDurationSecond(data.Get("min_retry_backoff").(string))
+	if err != nil {
+		return logical.ErrorResponse("invalid min_retry_backoff: %s", err), nil
+	}
+	maxBackoff, err := parseutil.ParseDurationSecond(data.Get("max_retry_backoff").(string))
+	if err != nil {
+		return logical.ErrorResponse("invalid max_retry_backoff: %s", err), nil
+	}
+
+	config := rootConfig{
+		AccessKey:             data.Get("access_key").(string),
+		SecretKey:             data.Get("secret_key").(string),
+		Region:                data.Get("region").(string),
+		IAMEndpoint:           data.Get("iam_endpoint").(string),
+		STSEndpoint:           data.Get("sts_endpoint").(string),
+		UsernameTemplate:      data.Get("username_template").(string),
+		DefaultIAMTags:        data.Get("default_iam_tags").(map[string]string),
+		MaxRetries:            data.Get("max_retries").(int),
+		MinRetryBackoff:       minBackoff,
+		MaxRetryBackoff:       maxBackoff,
+		IdentityTokenAudience: data.Get("identity_token_audience").(string),
+		IdentityTokenTTL:      time.Duration(data.Get("identity_token_ttl").(int)) * time.Second,
+		RoleARN:               data.Get("role_arn").(string),
+	}
+
+	if config.IdentityTokenAudience != "" && config.RoleARN == "" {
+		return logical.ErrorResponse("role_arn is required when identity_token_audience is set"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(storageKey, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	b.clientMutex.Lock()
+	defer b.clientMutex.Unlock()
+	b.iamClient = nil
+	b.ecrClient = nil
+
+	return nil, nil
+}
+
+func (b *backend) pathConfigRootRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	maxRetries, minBackoff, maxBackoff := config.retryConfig()
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"region":                  config.Region,
+			"iam_endpoint":            config.IAMEndpoint,
+			"sts_endpoint":            config.STSEndpoint,
+			"username_template":       config.UsernameTemplate,
+			"default_iam_tags":        config.DefaultIAMTags,
+			"max_retries":             maxRetries,
+			"min_retry_backoff":       minBackoff.String(),
+			"max_retry_backoff":       maxBackoff.String(),
+			"identity_token_audience": config.IdentityTokenAudience,
+			"identity_token_ttl":      int64(config.IdentityTokenTTL / time.Second),
+			"role_arn":                config.RoleARN,
+		},
+	}, nil
+}
+
+func pathConfigLease(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/lease",
+		Fields: map[string]*framework.FieldSchema{
+			"lease": {
+				Type:        framework.TypeDurationSecond,
+				Description: "Default lease TTL issued secrets should have.",
+			},
+			"lease_max": {
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum TTL an issued secret's lease can be renewed to.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{Callback: b.pathConfigLeaseWrite},
+			logical.ReadOperation:   &framework.PathOperation{Callback: b.pathConfigLeaseRead},
+		},
+	}
+}
+
+func (b *backend) pathConfigLeaseWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	lease := configLease{
+		Lease:    timeDurationSeconds(data.Get("lease")),
+		LeaseMax: timeDurationSeconds(data.Get("lease_max")),
+	}
+
+	entry, err := logical.StorageEntryJSON("config/lease", lease)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) pathConfigLeaseRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	lease, err := b.Lease(ctx, req.Storage, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"lease":     lease.Lease.String(),
+			"lease_max": lease.LeaseMax.String(),
+		},
+	}, nil
+}
@@ -0,0 +1,57 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathCreds(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "creds/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+			"ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: "TTL for the returned credentials.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{Callback: b.pathCredsRead},
+		},
+	}
+}
+
+func (b *backend) pathCredsRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("name").(string)
+	role, err := b.role(ctx, req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse("unknown role: %s", roleName), nil
+	}
+
+	ttl := int64(data.Get("ttl").(int))
+
+	// assume_role_arn brokers an ECR token directly from a chained
+	// cross-account assume-role session, bypassing IAM user provisioning
+	// entirely, so it takes priority over credential_type.
+	if role.AssumeRoleARN != "" {
+		return b.getAuthorizationToken(ctx, req.Storage, req.DisplayName, role)
+	}
+
+	switch role.CredentialType {
+	case "", credentialTypeIAMUser:
+		return b.secretAccessKeysCreate(ctx, req.Storage, req.DisplayName, roleName, role, ttl)
+	case credentialTypeAssumedRole, credentialTypeFederationToken:
+		return b.secretSTSCreate(ctx, req.Storage, req.DisplayName, roleName, role, ttl)
+	default:
+		return nil, fmt.Errorf("unsupported credential_type %q", role.CredentialType)
+	}
+}
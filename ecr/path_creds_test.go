@@ -0,0 +1,177 @@
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/aws/aws-sdk-go/service/ecr/ecriface"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// fakeIAM implements iamiface.IAMAPI with just enough to exercise
+// secretAccessKeysCreate; anything else panics so an unexpected call fails
+// loudly instead of silently returning a zero value.
+type fakeIAM struct {
+	iamiface.IAMAPI
+}
+
+func (f *fakeIAM) CreateUser(in *iam.CreateUserInput) (*iam.CreateUserOutput, error) {
+	return &iam.CreateUserOutput{User: &iam.User{UserName: in.UserName}}, nil
+}
+
+func (f *fakeIAM) AttachUserPolicy(*iam.AttachUserPolicyInput) (*iam.AttachUserPolicyOutput, error) {
+	return &iam.AttachUserPolicyOutput{}, nil
+}
+
+func (f *fakeIAM) CreateAccessKey(*iam.CreateAccessKeyInput) (*iam.CreateAccessKeyOutput, error) {
+	return &iam.CreateAccessKeyOutput{
+		AccessKey: &iam.AccessKey{
+			AccessKeyId:     aws.String("AKIAFAKE"),
+			SecretAccessKey: aws.String("fakesecret"),
+		},
+	}, nil
+}
+
+// fakeECR implements ecriface.ECRAPI, counting calls so tests can assert
+// GetAuthorizationToken was actually reached.
+type fakeECR struct {
+	ecriface.ECRAPI
+	calls int
+}
+
+func (f *fakeECR) GetAuthorizationToken(*ecr.GetAuthorizationTokenInput) (*ecr.GetAuthorizationTokenOutput, error) {
+	f.calls++
+	return &ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []*ecr.AuthorizationData{{
+			AuthorizationToken: aws.String("dG9rZW4="),
+			ProxyEndpoint:      aws.String("https://123456789012.dkr.ecr.us-east-1.amazonaws.com"),
+		}},
+	}, nil
+}
+
+func testBackend(t *testing.T) (*backend, logical.Storage, *fakeECR) {
+	t.Helper()
+
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend(config)
+	if err := b.Setup(context.Background(), config); err != nil {
+		t.Fatalf("unable to create backend: %s", err)
+	}
+
+	ecrClient := &fakeECR{}
+	b.iamClient = &fakeIAM{}
+	b.ecrClientForKeysOverride = ecrClient
+
+	return b, config.StorageView, ecrClient
+}
+
+func writeRole(t *testing.T, b *backend, s logical.Storage, name string, role *awsRoleEntry) {
+	t.Helper()
+	role.Name = name
+	entry, err := logical.StorageEntryJSON(roleStorageKey(name), role)
+	if err != nil {
+		t.Fatalf("unable to encode role: %s", err)
+	}
+	if err := s.Put(context.Background(), entry); err != nil {
+		t.Fatalf("unable to write role: %s", err)
+	}
+}
+
+// TestPathCredsRead_IAMUser guards against the iam_user credential_type
+// (the default) short-circuiting to the generated IAM user's raw,
+// durable access_key/secret_key instead of actually exchanging them for an
+// ECR authorization token.
+func TestPathCredsRead_IAMUser(t *testing.T) {
+	b, s, ecrClient := testBackend(t)
+	writeRole(t, b, s, "iam-user-role", &awsRoleEntry{RegistryPermission: "read"})
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "creds/iam-user-role",
+		Storage:     s,
+		DisplayName: "test",
+		Data:        map[string]interface{}{"name": "iam-user-role"},
+	})
+	if err != nil {
+		t.Fatalf("pathCredsRead returned error: %s", err)
+	}
+	if resp == nil || resp.IsError() {
+		t.Fatalf("unexpected error response: %#v", resp)
+	}
+
+	if ecrClient.calls != 1 {
+		t.Fatalf("expected GetAuthorizationToken to be called once, got %d", ecrClient.calls)
+	}
+	if _, ok := resp.Data["auth_token"]; !ok {
+		t.Fatalf("expected response to contain auth_token, got %#v", resp.Data)
+	}
+	if _, ok := resp.Data["registry_url"]; !ok {
+		t.Fatalf("expected response to contain registry_url, got %#v", resp.Data)
+	}
+	if _, ok := resp.Data["access_key"]; ok {
+		t.Fatalf("response leaked the IAM user's access_key: %#v", resp.Data)
+	}
+	if _, ok := resp.Data["secret_key"]; ok {
+		t.Fatalf("response leaked the IAM user's secret_key: %#v", resp.Data)
+	}
+}
+
+func TestPathCredsRead_UnknownRole(t *testing.T) {
+	b, s, _ := testBackend(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "creds/does-not-exist",
+		Storage:   s,
+		Data:      map[string]interface{}{"name": "does-not-exist"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error response for an unknown role, got %#v", resp)
+	}
+}
+
+// TestIsUnsupportedParameterErr confirms the Tags-rejection check only
+// fires when the error is actually about tags, so an unrelated bad
+// parameter (e.g. permissions_boundary_arn) surfaces directly instead of
+// triggering a spurious untagged retry.
+func TestIsUnsupportedParameterErr(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "tags rejected",
+			err:  awserr.New("InvalidParameterValue", "Unknown parameter in input: \"Tags\"", nil),
+			want: true,
+		},
+		{
+			name: "unrelated parameter rejected",
+			err:  awserr.New("InvalidParameterValue", "1 validation error detected: value at 'permissionsBoundary' failed to satisfy constraint", nil),
+			want: false,
+		},
+		{
+			name: "non-aws error",
+			err:  context.Canceled,
+			want: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isUnsupportedParameterErr(tc.err); got != tc.want {
+				t.Errorf("isUnsupportedParameterErr(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	credentialTypeIAMUser         = "iam_user"
+	credentialTypeAssumedRole     = "assumed_role"
+	credentialTypeFederationToken = "federation_token"
+)
+
+// awsRoleEntry describes how a role's ECR credentials should be issued:
+// which IAM policy to attach and which tags to apply to the generated user,
+// or, for the STS credential types, which role to assume.
+type awsRoleEntry struct {
+	Name                   string            `json:"name"`
+	CredentialType         string            `json:"credential_type"`
+	RegistryPermission     string            `json:"registry_permission"`
+	IAMTags                map[string]string `json:"iam_tags"`
+	IgnoreTagErrors        bool              `json:"ignore_tag_errors"`
+	PermissionsBoundaryARN string            `json:"permissions_boundary_arn"`
+	PolicyDocument         string            `json:"policy_document"`
+	PolicyARNs             []string          `json:"policy_arns"`
+	RoleARNs               []string          `json:"role_arns"`
+	MaxSTSTTL              int64             `json:"max_sts_ttl"`
+
+	// RegistryAccountID/AssumeRoleARN let a role broker ECR tokens for a
+	// registry that lives in a different AWS account than the root
+	// credentials: the backend assumes AssumeRoleARN in that account before
+	// calling ecr:GetAuthorizationToken.
+	RegistryAccountID   string `json:"registry_account_id"`
+	AssumeRoleARN       string `json:"assume_role_arn"`
+	ExternalID          string `json:"external_id"`
+	SessionNameTemplate string `json:"session_name_template"`
+}
+
+func pathRole(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "roles/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+			"credential_type": {
+				Type:        framework.TypeString,
+				Default:     credentialTypeIAMUser,
+				Description: "One of \"iam_user\" (default), \"assumed_role\", or \"federation_token\". The latter two issue short-lived STS credentials instead of creating a durable IAM user.",
+			},
+			"role_arns": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "For credential_type=assumed_role, the ARN of the role to assume (only the first entry is used today).",
+			},
+			"max_sts_ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum session duration to request for assumed_role/federation_token credentials; the requested TTL is clamped to this.",
+			},
+			"registry_account_id": {
+				Type:        framework.TypeString,
+				Description: "AWS account ID that owns the target ECR registry. Returned as registry_account_id with the token when assume_role_arn is set; it is not checked against the registry the token is issued for.",
+			},
+			"assume_role_arn": {
+				Type:        framework.TypeString,
+				Description: "ARN of a role, in another account, to assume with the root credentials before calling ecr:GetAuthorizationToken against that account's registry.",
+			},
+			"external_id": {
+				Type:        framework.TypeString,
+				Description: "External ID to pass when assuming assume_role_arn, if the target role requires one.",
+			},
+			"session_name_template": {
+				Type:        framework.TypeString,
+				Description: "Template for the RoleSessionName used when assuming assume_role_arn. Defaults to a name derived from the role.",
+			},
+			"registry_permission": {
+				Type:        framework.TypeString,
+				Description: "Either \"read\" or \"write\", selecting a hard-coded ECR managed policy.",
+			},
+			"iam_tags": {
+				Type:        framework.TypeKVPairs,
+				Description: "Tags to apply to the IAM user created for this role.",
+			},
+			"ignore_tag_errors": {
+				Type:        framework.TypeBool,
+				Description: "If set, a failure to tag the generated IAM user is logged and ignored instead of failing credential issuance.",
+			},
+			"permissions_boundary_arn": {
+				Type:        framework.TypeString,
+				Description: "ARN of a managed policy to set as the generated IAM user's permissions boundary.",
+			},
+			"policy_document": {
+				Type:        framework.TypeString,
+				Description: "Inline IAM policy JSON attached to the generated user via PutUserPolicy, as an alternative to registry_permission/policy_arns.",
+			},
+			"policy_arns": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Customer-managed or AWS-managed policy ARNs to attach to the generated user via AttachUserPolicy, as an alternative to registry_permission.",
+			},
+		},
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation:   &framework.PathOperation{Callback: b.pathRoleRead},
+			logical.UpdateOperation: &framework.PathOperation{Callback: b.pathRoleCreateUpdate},
+			logical.CreateOperation: &framework.PathOperation{Callback: b.pathRoleCreateUpdate},
+			logical.DeleteOperation: &framework.PathOperation{Callback: b.pathRoleDelete},
+		},
+		ExistenceCheck: b.pathRoleExistenceCheck,
+	}
+}
+
+// pathRoleExistenceCheck tells the framework whether to dispatch a write to
+// CreateOperation or UpdateOperation; both map to pathRoleCreateUpdate here,
+// but framework.Backend requires an ExistenceCheck whenever a path defines
+// both.
+func (b *backend) pathRoleExistenceCheck(ctx context.Context, req *logical.Request, data *framework.FieldData) (bool, error) {
+	role, err := b.role(ctx, req.Storage, data.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return role != nil, nil
+}
+
+func pathRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "roles/?$",
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ListOperation: &framework.PathOperation{Callback: b.pathRoleList},
+		},
+	}
+}
+
+func roleStorageKey(name string) string {
+	return "role/" + name
+}
+
+func (b *backend) role(ctx context.Context, s logical.Storage, name string) (*awsRoleEntry, error) {
+	entry, err := s.Get(ctx, roleStorageKey(name))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	role := new(awsRoleEntry)
+	if err := entry.DecodeJSON(role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+func (b *backend) pathRoleRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	role, err := b.role(ctx, req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"credential_type":          role.CredentialType,
+			"role_arns":                role.RoleARNs,
+			"max_sts_ttl":              role.MaxSTSTTL,
+			"registry_account_id":      role.RegistryAccountID,
+			"assume_role_arn":          role.AssumeRoleARN,
+			"external_id":              role.ExternalID,
+			"session_name_template":    role.SessionNameTemplate,
+			"registry_permission":      role.RegistryPermission,
+			"iam_tags":                 role.IAMTags,
+			"ignore_tag_errors":        role.IgnoreTagErrors,
+			"permissions_boundary_arn": role.PermissionsBoundaryARN,
+			"policy_document":          role.PolicyDocument,
+			"policy_arns":              role.PolicyARNs,
+		},
+	}, nil
+}
+
+func (b *backend) pathRoleCreateUpdate(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("name is required"), nil
+	}
+
+	role, err := b.role(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		role = &awsRoleEntry{Name: name}
+	}
+
+	if raw, ok := data.GetOk("credential_type"); ok {
+		role.CredentialType = raw.(string)
+	}
+	if raw, ok := data.GetOk("role_arns"); ok {
+		role.RoleARNs = raw.([]string)
+	}
+	if raw, ok := data.GetOk("max_sts_ttl"); ok {
+		role.MaxSTSTTL = int64(raw.(int))
+	}
+	if raw, ok := data.GetOk("registry_account_id"); ok {
+		role.RegistryAccountID = raw.(string)
+	}
+	if raw, ok := data.GetOk("assume_role_arn"); ok {
+		role.AssumeRoleARN = raw.(string)
+	}
+	if raw, ok := data.GetOk("external_id"); ok {
+		role.ExternalID = raw.(string)
+	}
+	if raw, ok := data.GetOk("session_name_template"); ok {
+		role.SessionNameTemplate = raw.(string)
+	}
+	if raw, ok := data.GetOk("registry_permission"); ok {
+		role.RegistryPermission = raw.(string)
+	}
+	if raw, ok := data.GetOk("iam_tags"); ok {
+		role.IAMTags = raw.(map[string]string)
+	}
+	if raw, ok := data.GetOk("ignore_tag_errors"); ok {
+		role.IgnoreTagErrors = raw.(bool)
+	}
+	if raw, ok := data.GetOk("permissions_boundary_arn"); ok {
+		role.PermissionsBoundaryARN = raw.(string)
+	}
+	if raw, ok := data.GetOk("policy_document"); ok {
+		role.PolicyDocument = raw.(string)
+	}
+	if raw, ok := data.GetOk("policy_arns"); ok {
+		role.PolicyARNs = raw.([]string)
+	}
+
+	entry, err := logical.StorageEntryJSON(roleStorageKey(name), role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathRoleDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete(ctx, roleStorageKey(data.Get("name").(string))); err != nil {
+		return nil, fmt.Errorf("error deleting role: %w", err)
+	}
+	return nil, nil
+}
+
+func (b *backend) pathRoleList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(ctx, "role/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(entries), nil
+}
@@ -0,0 +1,83 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/mitchellh/mapstructure"
+)
+
+// walUser is written before an IAM user is created so that a crash between
+// user creation and secret issuance can still clean the user up.
+type walUser struct {
+	UserName string
+}
+
+// pathUserRollback deletes the IAM user (and anything attached to it) named
+// in data. It is used both as the WAL rollback handler and directly from
+// secretAccessKeysRevoke.
+func (b *backend) pathUserRollback(ctx context.Context, req *logical.Request, kind string, data interface{}) error {
+	var entry walUser
+	if err := mapstructure.Decode(data, &entry); err != nil {
+		return err
+	}
+	username := entry.UserName
+	if username == "" {
+		return nil
+	}
+
+	iamClient, err := b.clientIAM(ctx, req.Storage)
+	if err != nil {
+		return err
+	}
+
+	// Detach and delete anything that would otherwise block DeleteUser.
+	if policies, err := iamClient.ListAttachedUserPolicies(&iam.ListAttachedUserPoliciesInput{
+		UserName: aws.String(username),
+	}); err == nil {
+		for _, p := range policies.AttachedPolicies {
+			_, _ = iamClient.DetachUserPolicy(&iam.DetachUserPolicyInput{
+				UserName:  aws.String(username),
+				PolicyArn: p.PolicyArn,
+			})
+		}
+	}
+
+	if inline, err := iamClient.ListUserPolicies(&iam.ListUserPoliciesInput{
+		UserName: aws.String(username),
+	}); err == nil {
+		for _, name := range inline.PolicyNames {
+			_, _ = iamClient.DeleteUserPolicy(&iam.DeleteUserPolicyInput{
+				UserName:   aws.String(username),
+				PolicyName: name,
+			})
+		}
+	}
+
+	if keys, err := iamClient.ListAccessKeys(&iam.ListAccessKeysInput{
+		UserName: aws.String(username),
+	}); err == nil {
+		for _, k := range keys.AccessKeyMetadata {
+			_, _ = iamClient.DeleteAccessKey(&iam.DeleteAccessKeyInput{
+				UserName:    aws.String(username),
+				AccessKeyId: k.AccessKeyId,
+			})
+		}
+	}
+
+	_, err = iamClient.DeleteUser(&iam.DeleteUserInput{
+		UserName: aws.String(username),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == iam.ErrCodeNoSuchEntityException {
+			return nil
+		}
+		return fmt.Errorf("error deleting IAM user %q: %w", username, err)
+	}
+
+	return nil
+}
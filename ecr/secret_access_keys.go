@@ -3,8 +3,10 @@ package aws
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"regexp"
-	// "time"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/hashicorp/go-hclog"
@@ -25,19 +27,20 @@ const (
 	storageKey                 = "config/root"
 	registryPermissionReadArn  = "arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryReadOnly"
 	registryPermissionWriteArn = "arn:aws:iam::aws:policy/AmazonEC2ContainerRegistryPowerUser"
+	inlineUserPolicyName       = "ecr-secrets-policy"
 )
 
 func secretAccessKeys(b *backend) *framework.Secret {
 	return &framework.Secret{
 		Type: secretAccessKeyType,
 		Fields: map[string]*framework.FieldSchema{
-			"access_key": {
+			"auth_token": {
 				Type:        framework.TypeString,
-				Description: "Access Key",
+				Description: "ECR authorization token.",
 			},
-			"secret_key": {
+			"registry_url": {
 				Type:        framework.TypeString,
-				Description: "Secret Key",
+				Description: "ECR registry endpoint the token is valid for.",
 			},
 		},
 
@@ -69,40 +72,48 @@ func genUsername(displayName, policyName, usernameTemplate string) (ret string,
 	return
 }
 
-func getAuthorizationTokenHelper(ecrClient ecriface.ECRAPI, maxRetries int, startCount int, logger hclog.Logger) (*ecr.GetAuthorizationTokenOutput, error) {
+// getAuthorizationTokenHelper retries GetAuthorizationToken when it fails
+// with UnrecognizedClientException, which ECR returns for a short window
+// after the credentials behind ecrClient aren't yet propagated - whether
+// that's a newly created IAM access key or a freshly assumed STS session.
+// Retries use full-jitter exponential backoff with base minBackoff and cap
+// maxBackoff, and stop as soon as ctx is done.
+func getAuthorizationTokenHelper(ctx context.Context, ecrClient ecriface.ECRAPI, maxRetries int, minBackoff, maxBackoff time.Duration, logger hclog.Logger) (*ecr.GetAuthorizationTokenOutput, error) {
 	getTokenInput := &ecr.GetAuthorizationTokenInput{}
-	tokenResp, err := ecrClient.GetAuthorizationToken(getTokenInput)
-	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			if aerr.Code() == "UnrecognizedClientException" &&
-				aerr.Message() == "The security token included in the request is invalid." &&
-				startCount < maxRetries {
-				startCount++
-				logger.Info(fmt.Sprintf("Failed to retrieve ECR token, tried (%d) of (%d).", startCount, maxRetries))
-				return getAuthorizationTokenHelper(ecrClient, maxRetries, startCount, logger)
-			}
+
+	for attempt := 0; ; attempt++ {
+		tokenResp, err := ecrClient.GetAuthorizationToken(getTokenInput)
+		if err == nil {
+			return tokenResp, nil
+		}
+
+		aerr, ok := err.(awserr.Error)
+		if !ok || aerr.Code() != "UnrecognizedClientException" ||
+			aerr.Message() != "The security token included in the request is invalid." ||
+			attempt >= maxRetries {
+			return nil, err
 		}
-		return nil, err
-	}
-	return tokenResp, nil
-}
 
-func (b *backend) getAuthorizationToken(ctx context.Context, s logical.Storage, auth *logical.Response) (*logical.Response, error) {
-	ecrClient, err := b.clientECR(ctx, s, auth)
+		backoff := fullJitterBackoff(attempt, minBackoff, maxBackoff)
+		logger.Info(fmt.Sprintf("Failed to retrieve ECR token, credentials likely not yet propagated; retrying in %s (%d of %d).", backoff, attempt+1, maxRetries))
 
-	var maxRetries int = 30
-	tokenResp, err := getAuthorizationTokenHelper(ecrClient, maxRetries, 0, b.Logger())
-	if err != nil {
-		return nil, fmt.Errorf("Error generating ECR token: %s\nCheckAWSError: %s", err, awsutil.CheckAWSError(err))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
 	}
+}
 
-	return &logical.Response{
-		Data: map[string]interface{}{
-			"auth_token":   *tokenResp.AuthorizationData[0].AuthorizationToken,
-			"registry_url": *tokenResp.AuthorizationData[0].ProxyEndpoint,
-		},
-		Secret: auth.Secret,
-	}, nil
+// fullJitterBackoff implements the "full jitter" backoff from
+// https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/:
+// a random duration in [0, min*2^attempt], capped at max.
+func fullJitterBackoff(attempt int, min, max time.Duration) time.Duration {
+	backoffCap := max
+	if shifted := min << uint(attempt); shifted > 0 && shifted < max {
+		backoffCap = shifted
+	}
+	return time.Duration(rand.Int63n(int64(backoffCap) + 1))
 }
 
 func readConfig(ctx context.Context, storage logical.Storage) (rootConfig, error) {
@@ -162,13 +173,28 @@ func (b *backend) secretAccessKeysCreate(
 
 	userPath := fmt.Sprintf("/%s/", username)
 
+	tags := mergeIAMTags(config.DefaultIAMTags, role.IAMTags)
+
 	createUserRequest := &iam.CreateUserInput{
 		UserName: aws.String(username),
 		Path:     aws.String(userPath),
 	}
+	if len(tags) > 0 {
+		createUserRequest.Tags = tags
+	}
+	if role.PermissionsBoundaryARN != "" {
+		createUserRequest.PermissionsBoundary = aws.String(role.PermissionsBoundaryARN)
+	}
 
-	// Create the user
+	// Create the user. Some AWS partitions (ISO, ISOB, and other
+	// non-standard regions) reject the Tags parameter on CreateUser, so if
+	// that's what fails, retry without tags and tag the user afterwards.
 	_, err = iamClient.CreateUser(createUserRequest)
+	if err != nil && len(tags) > 0 && isUnsupportedParameterErr(err) {
+		b.Logger().Warn("CreateUser with tags was rejected, retrying untagged", "username", username, "error", err)
+		createUserRequest.Tags = nil
+		_, err = iamClient.CreateUser(createUserRequest)
+	}
 	if err != nil {
 		if walErr := framework.DeleteWAL(ctx, s, walID); walErr != nil {
 			iamErr := fmt.Errorf("error creating IAM user: %w", err)
@@ -177,48 +203,58 @@ func (b *backend) secretAccessKeysCreate(
 		return logical.ErrorResponse("Error creating IAM user: %s", err), awsutil.CheckAWSError(err)
 	}
 
+	if len(tags) > 0 && createUserRequest.Tags == nil {
+		if _, tagErr := iamClient.TagUser(&iam.TagUserInput{
+			Tags:     tags,
+			UserName: aws.String(username),
+		}); tagErr != nil {
+			if role.IgnoreTagErrors && isTagUserToleratedErr(tagErr) {
+				b.Logger().Warn("failed to tag IAM user, continuing without tags", "username", username, "error", tagErr)
+			} else {
+				return logical.ErrorResponse("Error adding tags to user: %s", tagErr), awsutil.CheckAWSError(tagErr)
+			}
+		}
+	}
+
 	resp := b.Secret(secretAccessKeyType).Response(map[string]interface{}{}, map[string]interface{}{
 		"username": username,
 	})
 
-	arn := ""
+	// registry_permission, policy_arns, and policy_document are complementary
+	// ways of granting the generated user access: the hard-coded ECR
+	// managed policies, arbitrary managed/customer-managed policy ARNs, and
+	// a scoped-down inline policy, respectively. A role can combine them.
+	attachArns := make([]string, 0, len(role.PolicyARNs)+1)
 	switch role.RegistryPermission {
 	case "read":
-		arn = registryPermissionReadArn
+		attachArns = append(attachArns, registryPermissionReadArn)
 	case "write":
-		arn = registryPermissionWriteArn
+		attachArns = append(attachArns, registryPermissionWriteArn)
 	}
-	// Attach existing policy against user
-	_, err = iamClient.AttachUserPolicy(&iam.AttachUserPolicyInput{
-		UserName:  aws.String(username),
-		PolicyArn: aws.String(arn),
-	})
-	if err != nil {
-		return resp, fmt.Errorf("Error attaching user policy: %s. %s", err, awsutil.CheckAWSError(err))
+	attachArns = append(attachArns, role.PolicyARNs...)
+
+	for _, policyArn := range attachArns {
+		_, err = iamClient.AttachUserPolicy(&iam.AttachUserPolicyInput{
+			UserName:  aws.String(username),
+			PolicyArn: aws.String(policyArn),
+		})
+		if err != nil {
+			return resp, fmt.Errorf("Error attaching user policy %s: %s. %s", policyArn, err, awsutil.CheckAWSError(err))
+		}
 	}
 
-	resp.Secret.InternalData["policy"] = role
-
-	// TODO
-	// var tags []*iam.Tag
-	// for key, value := range role.IAMTags {
-	// 	// This assignment needs to be done in order to create unique addresses for
-	// 	// these variables. Without doing so, all the tags will be copies of the last
-	// 	// tag listed in the role.
-	// 	k, v := key, value
-	// 	tags = append(tags, &iam.Tag{Key: &k, Value: &v})
-	// }
-
-	// if len(tags) > 0 {
-	// 	_, err = iamClient.TagUser(&iam.TagUserInput{
-	// 		Tags:     tags,
-	// 		UserName: &username,
-	// 	})
+	if role.PolicyDocument != "" {
+		_, err = iamClient.PutUserPolicy(&iam.PutUserPolicyInput{
+			UserName:       aws.String(username),
+			PolicyName:     aws.String(inlineUserPolicyName),
+			PolicyDocument: aws.String(role.PolicyDocument),
+		})
+		if err != nil {
+			return resp, fmt.Errorf("Error putting inline user policy: %s. %s", err, awsutil.CheckAWSError(err))
+		}
+	}
 
-	// 	if err != nil {
-	// 		return logical.ErrorResponse("Error adding tags to user: %s", err), awsutil.CheckAWSError(err)
-	// 	}
-	// }
+	resp.Secret.InternalData["policy"] = role
 
 	// Create the keys
 	keyResp, err := iamClient.CreateAccessKey(&iam.CreateAccessKeyInput{
@@ -231,6 +267,26 @@ func (b *backend) secretAccessKeysCreate(
 	resp.Secret.InternalData["access_key"] = *keyResp.AccessKey.AccessKeyId
 	resp.Secret.InternalData["secret_key"] = *keyResp.AccessKey.SecretAccessKey
 
+	// The whole point of this backend is an ECR authorization token, not the
+	// durable IAM credentials used to mint it, so exchange the access key
+	// we just created for one before returning. It's brand new, so ECR may
+	// briefly return UnrecognizedClientException until it propagates. This
+	// has to happen before the WAL entry below is removed: if the exchange
+	// fails we return without a lease registered for the user we just
+	// created, so the WAL is the only thing left that can clean it up.
+	ecrClient, err := b.ecrClientForKeys(ctx, s, *keyResp.AccessKey.AccessKeyId, *keyResp.AccessKey.SecretAccessKey)
+	if err != nil {
+		return resp, err
+	}
+	maxRetries, minBackoff, maxBackoff := config.retryConfig()
+	tokenResp, err := getAuthorizationTokenHelper(ctx, ecrClient, maxRetries, minBackoff, maxBackoff, b.Logger())
+	if err != nil {
+		return resp, fmt.Errorf("Error generating ECR token: %s\nCheckAWSError: %s", err, awsutil.CheckAWSError(err))
+	}
+
+	resp.Data["auth_token"] = *tokenResp.AuthorizationData[0].AuthorizationToken
+	resp.Data["registry_url"] = *tokenResp.AuthorizationData[0].ProxyEndpoint
+
 	// Remove the WAL entry, we succeeded! If we fail, we don't return
 	// the secret because it'll get rolled back anyways, so we have to return
 	// an error here.
@@ -274,6 +330,60 @@ func (b *backend) secretAccessKeysRevoke(ctx context.Context, req *logical.Reque
 	return nil, nil
 }
 
+// mergeIAMTags combines the backend-wide default tags with the role's own
+// tags, letting the role override a default of the same key. The range
+// variables are reused on every iteration, so each tag's key/value is
+// copied to its own variables before taking their addresses.
+func mergeIAMTags(defaults, roleTags map[string]string) []*iam.Tag {
+	merged := make(map[string]string, len(defaults)+len(roleTags))
+	for k, v := range defaults {
+		merged[k] = v
+	}
+	for k, v := range roleTags {
+		merged[k] = v
+	}
+
+	var tags []*iam.Tag
+	for key, value := range merged {
+		k, v := key, value
+		tags = append(tags, &iam.Tag{Key: &k, Value: &v})
+	}
+	return tags
+}
+
+// isUnsupportedParameterErr reports whether err looks like an AWS partition
+// (ISO, ISOB, etc.) rejecting the Tags parameter on CreateUser specifically.
+// The error code alone (e.g. InvalidParameterValue) isn't enough to tell
+// that apart from some other bad parameter, such as an invalid
+// permissions_boundary_arn, so this also checks that AWS's message actually
+// names the tags parameter.
+func isUnsupportedParameterErr(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+	switch aerr.Code() {
+	case "InvalidParameterValue", "UnknownOperationException", "UnsupportedOperation":
+		return strings.Contains(strings.ToLower(aerr.Message()), "tag")
+	}
+	return false
+}
+
+// isTagUserToleratedErr reports whether a failed TagUser call is the kind of
+// partition restriction that role.IgnoreTagErrors allows us to swallow,
+// rather than an error that should fail credential issuance.
+func isTagUserToleratedErr(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return false
+	}
+	switch aerr.Code() {
+	case "AccessDenied", "UnknownOperationException", "UnsupportedOperation":
+		return true
+	}
+	return false
+}
+
 func normalizeDisplayName(displayName string) string {
 	re := regexp.MustCompile("[^a-zA-Z0-9+=,.@_-]")
 	return re.ReplaceAllString(displayName, "_")
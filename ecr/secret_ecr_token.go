@@ -0,0 +1,87 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-secure-stdlib/awsutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// secretEcrTokenType is the secret type for ECR tokens brokered via a
+// role's assume_role_arn (see clientECRForRole): cross-account access, no
+// IAM user involved. There's nothing to revoke - the token is read-only and
+// the chained STS session, if any, expires on its own.
+const secretEcrTokenType = "ecr_token"
+
+func secretECRToken(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: secretEcrTokenType,
+		Fields: map[string]*framework.FieldSchema{
+			"auth_token": {
+				Type:        framework.TypeString,
+				Description: "ECR authorization token.",
+			},
+			"registry_url": {
+				Type:        framework.TypeString,
+				Description: "ECR registry endpoint the token is valid for.",
+			},
+			"registry_account_id": {
+				Type:        framework.TypeString,
+				Description: "AWS account ID that owns the registry, when assume_role_arn is set.",
+			},
+		},
+
+		Revoke: b.secretECRTokenRevoke,
+	}
+}
+
+func (b *backend) secretECRTokenRevoke(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return nil, nil
+}
+
+// getAuthorizationToken mints an ECR authorization token for a role
+// configured with assume_role_arn, routing the request through
+// clientECRForRole's chained cross-account assume-role so it never needs to
+// provision an IAM user in the target account.
+func (b *backend) getAuthorizationToken(ctx context.Context, s logical.Storage, displayName string, role *awsRoleEntry) (*logical.Response, error) {
+	ecrClient, expiration, err := b.clientECRForRole(ctx, s, displayName, role)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := readConfig(ctx, s)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read configuration: %w", err)
+	}
+	maxRetries, minBackoff, maxBackoff := config.retryConfig()
+
+	tokenResp, err := getAuthorizationTokenHelper(ctx, ecrClient, maxRetries, minBackoff, maxBackoff, b.Logger())
+	if err != nil {
+		return nil, fmt.Errorf("Error generating ECR token: %s\nCheckAWSError: %s", err, awsutil.CheckAWSError(err))
+	}
+
+	data := map[string]interface{}{
+		"auth_token":   *tokenResp.AuthorizationData[0].AuthorizationToken,
+		"registry_url": *tokenResp.AuthorizationData[0].ProxyEndpoint,
+	}
+	if role.RegistryAccountID != "" {
+		data["registry_account_id"] = role.RegistryAccountID
+	}
+
+	resp := b.Secret(secretEcrTokenType).Response(data, map[string]interface{}{})
+
+	// The token shouldn't outlive the chained STS session it was fetched
+	// under.
+	if expiration != nil {
+		if ttl := time.Until(*expiration); ttl > 0 {
+			resp.Secret.TTL = ttl
+			resp.Secret.MaxTTL = ttl
+		}
+	}
+	resp.Secret.Renewable = false
+
+	return resp, nil
+}
@@ -0,0 +1,162 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const secretStsType = "sts_creds"
+
+// minSTSTTL/maxSTSTTL mirror the bounds STS itself enforces on
+// DurationSeconds for AssumeRole and GetFederationToken.
+const (
+	minSTSTTL     = 900
+	maxSTSTTL     = 129600
+	defaultSTSTTL = 3600
+)
+
+func secretSTSCreds(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: secretStsType,
+		Fields: map[string]*framework.FieldSchema{
+			"access_key": {
+				Type:        framework.TypeString,
+				Description: "Access Key",
+			},
+			"secret_key": {
+				Type:        framework.TypeString,
+				Description: "Secret Key",
+			},
+			"session_token": {
+				Type:        framework.TypeString,
+				Description: "Session Token",
+			},
+		},
+
+		// STS-issued credentials are short-lived and self-expiring; there is
+		// no IAM user or key to clean up, so revocation is a no-op.
+		Revoke: b.secretSTSRevoke,
+	}
+}
+
+func (b *backend) secretSTSRevoke(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return nil, nil
+}
+
+func stsDurationSeconds(requestedTTL, maxTTL int64) int64 {
+	max := int64(maxSTSTTL)
+	if maxTTL > 0 && maxTTL < max {
+		max = maxTTL
+	}
+
+	d := requestedTTL
+	if d <= 0 {
+		d = defaultSTSTTL
+	}
+	if d < minSTSTTL {
+		d = minSTSTTL
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+func (b *backend) secretSTSCreate(
+	ctx context.Context,
+	s logical.Storage,
+	displayName, roleName string,
+	role *awsRoleEntry, lifeTimeInSeconds int64,
+) (*logical.Response, error) {
+	stsClient, err := b.clientSTS(ctx, s)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	duration := stsDurationSeconds(lifeTimeInSeconds, role.MaxSTSTTL)
+
+	var accessKey, secretKey, sessionToken string
+	var expiration int64
+
+	switch role.CredentialType {
+	case credentialTypeAssumedRole:
+		if len(role.RoleARNs) == 0 {
+			return logical.ErrorResponse("role %q has credential_type=assumed_role but no role_arns configured", roleName), nil
+		}
+
+		sessionName, err := genUsername(displayName, roleName, defaultUserNameTemplate)
+		if err != nil {
+			return nil, err
+		}
+
+		out, err := stsClient.AssumeRole(&sts.AssumeRoleInput{
+			RoleArn:         aws.String(role.RoleARNs[0]),
+			RoleSessionName: aws.String(sessionName),
+			DurationSeconds: aws.Int64(duration),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error assuming role %s: %w", role.RoleARNs[0], err)
+		}
+
+		accessKey = *out.Credentials.AccessKeyId
+		secretKey = *out.Credentials.SecretAccessKey
+		sessionToken = *out.Credentials.SessionToken
+		expiration = out.Credentials.Expiration.Unix()
+
+	case credentialTypeFederationToken:
+		// GetFederationToken's Name is capped at 32 chars matching
+		// [\w+=,.@-], which roleName isn't guaranteed to satisfy.
+		name, err := genUsername(displayName, roleName, defaultFederationNameTemplate)
+		if err != nil {
+			return nil, err
+		}
+
+		input := &sts.GetFederationTokenInput{
+			Name:            aws.String(name),
+			DurationSeconds: aws.Int64(duration),
+		}
+		if role.PolicyDocument != "" {
+			input.Policy = aws.String(role.PolicyDocument)
+		}
+		for _, arn := range role.PolicyARNs {
+			input.PolicyArns = append(input.PolicyArns, &sts.PolicyDescriptorType{Arn: aws.String(arn)})
+		}
+
+		out, err := stsClient.GetFederationToken(input)
+		if err != nil {
+			return nil, fmt.Errorf("error getting federation token: %w", err)
+		}
+
+		accessKey = *out.Credentials.AccessKeyId
+		secretKey = *out.Credentials.SecretAccessKey
+		sessionToken = *out.Credentials.SessionToken
+		expiration = out.Credentials.Expiration.Unix()
+
+	default:
+		return nil, fmt.Errorf("unsupported credential_type %q for STS issuance", role.CredentialType)
+	}
+
+	resp := b.Secret(secretStsType).Response(map[string]interface{}{
+		"access_key":    accessKey,
+		"secret_key":    secretKey,
+		"session_token": sessionToken,
+	}, map[string]interface{}{
+		"credential_type": role.CredentialType,
+	})
+
+	if ttl := time.Until(time.Unix(expiration, 0)); ttl > 0 {
+		resp.Secret.TTL = ttl
+		resp.Secret.MaxTTL = ttl
+	}
+	// STS credentials can't be renewed past what AssumeRole/GetFederationToken
+	// already granted, so don't let Vault attempt to extend the lease.
+	resp.Secret.Renewable = false
+
+	return resp, nil
+}
@@ -0,0 +1,13 @@
+package aws
+
+import "time"
+
+// timeDurationSeconds converts a framework.TypeDurationSecond field value
+// (an int number of seconds) into a time.Duration.
+func timeDurationSeconds(raw interface{}) time.Duration {
+	seconds, ok := raw.(int)
+	if !ok {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}